@@ -0,0 +1,219 @@
+package neuraltree
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/unixpickle/autofunc"
+)
+
+// ApplyBatch is like Apply, but it processes a batch of
+// inputs together. At every node, the node's network is run
+// once for the whole batch via Network.Batch, rather than
+// once per input, and the children are descended into once
+// for the whole batch as well, rather than walking the tree
+// separately for each input.
+func (n *Node) ApplyBatch(inputs []autofunc.Result) []autofunc.Result {
+	weights := splitBatch(n.Network.Batch(autofunc.Concat(inputs...), len(inputs)), len(inputs))
+	if len(n.Children) == 0 {
+		return weights
+	}
+
+	childOuts := make([][]autofunc.Result, len(n.Children))
+	for i, child := range n.Children {
+		childOuts[i] = child.ApplyBatch(inputs)
+	}
+
+	res := make([]autofunc.Result, len(inputs))
+	for i := range inputs {
+		if len(weights[i].Output()) != len(n.Children) {
+			panic("child node count must match network output size")
+		}
+		res[i] = autofunc.Pool(weights[i], func(w autofunc.Result) autofunc.Result {
+			var sum autofunc.Result
+			for c := range n.Children {
+				weight := autofunc.Slice(w, c, c+1)
+				weighted := autofunc.AddFirst(childOuts[c][i], weight)
+				if sum == nil {
+					sum = weighted
+				} else {
+					sum = logExpSum(sum, weighted)
+				}
+			}
+			return sum
+		})
+	}
+	return res
+}
+
+// ApplyBatchR is the r-operator version of ApplyBatch.
+func (n *Node) ApplyBatchR(rv autofunc.RVector, inputs []autofunc.RResult) []autofunc.RResult {
+	weights := splitBatchR(n.Network.BatchR(rv, autofunc.ConcatR(inputs...), len(inputs)), len(inputs))
+	if len(n.Children) == 0 {
+		return weights
+	}
+
+	childOuts := make([][]autofunc.RResult, len(n.Children))
+	for i, child := range n.Children {
+		childOuts[i] = child.ApplyBatchR(rv, inputs)
+	}
+
+	res := make([]autofunc.RResult, len(inputs))
+	for i := range inputs {
+		if len(weights[i].Output()) != len(n.Children) {
+			panic("child node count must match network output size")
+		}
+		res[i] = autofunc.PoolR(weights[i], func(w autofunc.RResult) autofunc.RResult {
+			var sum autofunc.RResult
+			for c := range n.Children {
+				weight := autofunc.SliceR(w, c, c+1)
+				weighted := autofunc.AddFirstR(childOuts[c][i], weight)
+				if sum == nil {
+					sum = weighted
+				} else {
+					sum = logExpSumR(sum, weighted)
+				}
+			}
+			return sum
+		})
+	}
+	return res
+}
+
+// splitBatch slices a single Result produced by Network.Batch
+// for n inputs back into n equally-sized per-input Results.
+func splitBatch(out autofunc.Result, n int) []autofunc.Result {
+	width := len(out.Output()) / n
+	res := make([]autofunc.Result, n)
+	for i := range res {
+		res[i] = autofunc.Slice(out, i*width, (i+1)*width)
+	}
+	return res
+}
+
+// splitBatchR is the r-operator version of splitBatch.
+func splitBatchR(out autofunc.RResult, n int) []autofunc.RResult {
+	width := len(out.Output()) / n
+	res := make([]autofunc.RResult, n)
+	for i := range res {
+		res[i] = autofunc.SliceR(out, i*width, (i+1)*width)
+	}
+	return res
+}
+
+// A Predictor runs a Node over large, potentially unbounded
+// input sets using a pool of worker goroutines, splitting
+// the work into fixed-size batches so that inference over
+// huge test sets is both parallelized and never requires
+// holding every output in memory at once.
+type Predictor struct {
+	Node *Node
+
+	// NumWorkers is the number of goroutines used to process
+	// batches concurrently. If 0, runtime.GOMAXPROCS(0) is
+	// used.
+	NumWorkers int
+
+	// BatchSize is the number of inputs processed by a
+	// single ApplyBatch call. If 0, a default of 32 is used.
+	BatchSize int
+}
+
+// Predict runs inputs through the predictor's Node and
+// invokes cb once for every input, in input order, with its
+// index and its resulting output. Batches are computed
+// concurrently across NumWorkers goroutines, but delivery to
+// cb is serialized and reordered so that cb always observes
+// idx 0, 1, 2, ... in sequence. Batches that complete ahead
+// of the next batch to be delivered are held until it has
+// been delivered; delivered outputs are not retained.
+//
+// Predict blocks until every input has been processed.
+func (p *Predictor) Predict(inputs []autofunc.Result, cb func(idx int, output autofunc.Result)) {
+	batchSize := p.BatchSize
+	if batchSize == 0 {
+		batchSize = 32
+	}
+	numWorkers := p.NumWorkers
+	if numWorkers == 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	type batch struct {
+		start int
+		items []autofunc.Result
+	}
+	type batchResult struct {
+		start int
+		outs  []autofunc.Result
+	}
+	batches := make(chan batch, numWorkers)
+	results := make(chan batchResult, numWorkers)
+
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				results <- batchResult{start: b.start, outs: p.Node.ApplyBatch(b.items)}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	go func() {
+		for i := 0; i < len(inputs); i += batchSize {
+			end := i + batchSize
+			if end > len(inputs) {
+				end = len(inputs)
+			}
+			batches <- batch{start: i, items: inputs[i:end]}
+		}
+		close(batches)
+	}()
+
+	pending := map[int][]autofunc.Result{}
+	next := 0
+	for r := range results {
+		pending[r.start] = r.outs
+		for {
+			outs, ok := pending[next]
+			if !ok {
+				break
+			}
+			for i, out := range outs {
+				cb(next+i, out)
+			}
+			delete(pending, next)
+			next += len(outs)
+		}
+	}
+}
+
+// PredictChan is like Predict, but streams indexed results
+// over a channel instead of invoking a callback. The
+// channel is closed once every input has been processed,
+// which makes it convenient to range over results as they
+// become available without buffering the entire output set.
+func (p *Predictor) PredictChan(inputs []autofunc.Result) <-chan IndexedResult {
+	out := make(chan IndexedResult, p.BatchSize)
+	go func() {
+		defer close(out)
+		p.Predict(inputs, func(idx int, output autofunc.Result) {
+			out <- IndexedResult{Index: idx, Output: output}
+		})
+	}()
+	return out
+}
+
+// An IndexedResult pairs a Predictor output with the index
+// of the input (in the original input slice) that produced
+// it.
+type IndexedResult struct {
+	Index  int
+	Output autofunc.Result
+}
@@ -0,0 +1,169 @@
+package neuraltree
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// jsonNode mirrors Node's structure for JSON encoding.
+type jsonNode struct {
+	Children []*jsonNode  `json:"children,omitempty"`
+	Network  *jsonNetwork `json:"network"`
+}
+
+// jsonNetwork mirrors a neuralnet.Network for JSON encoding.
+type jsonNetwork struct {
+	Layers []*jsonLayer `json:"layers"`
+}
+
+// jsonLayer mirrors a single neuralnet.Layer for JSON
+// encoding. Fields that don't apply to a given layer's
+// Type are omitted.
+type jsonLayer struct {
+	Type    string    `json:"type"`
+	In      int       `json:"in,omitempty"`
+	Out     int       `json:"out,omitempty"`
+	Weights []float64 `json:"weights,omitempty"`
+	Biases  []float64 `json:"biases,omitempty"`
+}
+
+// MarshalJSON encodes n as a structured document describing
+// every layer of every node in the subtree rooted at n, so
+// that the tree can be loaded, diffed, or hand-edited
+// outside of Go. See DeserializeNodeJSON for the supported
+// layer types.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	jn, err := n.toJSONNode()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jn)
+}
+
+func (n *Node) toJSONNode() (*jsonNode, error) {
+	net, err := networkToJSON(n.Network)
+	if err != nil {
+		return nil, err
+	}
+	jn := &jsonNode{Network: net}
+	for _, child := range n.Children {
+		jc, err := child.toJSONNode()
+		if err != nil {
+			return nil, err
+		}
+		jn.Children = append(jn.Children, jc)
+	}
+	return jn, nil
+}
+
+func networkToJSON(net neuralnet.Network) (*jsonNetwork, error) {
+	res := &jsonNetwork{}
+	for _, layer := range net {
+		switch l := layer.(type) {
+		case *neuralnet.DenseLayer:
+			res.Layers = append(res.Layers, &jsonLayer{
+				Type:    "Dense",
+				In:      l.InputCount,
+				Out:     l.OutputCount,
+				Weights: append([]float64{}, l.Weights.Data.Vector...),
+				Biases:  append([]float64{}, l.Biases.Vector...),
+			})
+		case *neuralnet.HyperbolicTangent:
+			res.Layers = append(res.Layers, &jsonLayer{Type: "Tanh"})
+		case *neuralnet.LogSoftmaxLayer:
+			res.Layers = append(res.Layers, &jsonLayer{Type: "LogSoftmax"})
+		default:
+			return nil, fmt.Errorf("neuraltree: JSON marshal: unsupported layer type %T", layer)
+		}
+	}
+	return res, nil
+}
+
+// UnmarshalJSON decodes a document produced by MarshalJSON
+// back into n.
+func (n *Node) UnmarshalJSON(data []byte) error {
+	var jn jsonNode
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return err
+	}
+	node, err := jn.toNode()
+	if err != nil {
+		return err
+	}
+	*n = *node
+	return nil
+}
+
+// DeserializeNodeJSON parses a document produced by
+// (*Node).MarshalJSON, reconstructing the tree and every
+// layer's weights. The supported layer types are "Dense",
+// "Tanh" and "LogSoftmax"; any other type produces an error
+// rather than being silently dropped.
+func DeserializeNodeJSON(data []byte) (*Node, error) {
+	var jn jsonNode
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return nil, err
+	}
+	return jn.toNode()
+}
+
+func (jn *jsonNode) toNode() (*Node, error) {
+	net, err := jn.Network.toNetwork()
+	if err != nil {
+		return nil, err
+	}
+	node := &Node{Network: net}
+	for _, jc := range jn.Children {
+		child, err := jc.toNode()
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+func (jnet *jsonNetwork) toNetwork() (neuralnet.Network, error) {
+	net := make(neuralnet.Network, len(jnet.Layers))
+	for i, jl := range jnet.Layers {
+		layer, err := jl.toLayer()
+		if err != nil {
+			return nil, err
+		}
+		net[i] = layer
+	}
+	return net, nil
+}
+
+func (jl *jsonLayer) toLayer() (neuralnet.Layer, error) {
+	switch jl.Type {
+	case "Dense":
+		if len(jl.Weights) != jl.In*jl.Out {
+			return nil, fmt.Errorf("neuraltree: JSON unmarshal: Dense layer has %d weights, want %d",
+				len(jl.Weights), jl.In*jl.Out)
+		}
+		if len(jl.Biases) != jl.Out {
+			return nil, fmt.Errorf("neuraltree: JSON unmarshal: Dense layer has %d biases, want %d",
+				len(jl.Biases), jl.Out)
+		}
+		return &neuralnet.DenseLayer{
+			InputCount:  jl.In,
+			OutputCount: jl.Out,
+			Weights: &neuralnet.Matrix{
+				Data: &autofunc.Variable{Vector: append([]float64{}, jl.Weights...)},
+				Rows: jl.Out,
+				Cols: jl.In,
+			},
+			Biases: &autofunc.Variable{Vector: append([]float64{}, jl.Biases...)},
+		}, nil
+	case "Tanh":
+		return &neuralnet.HyperbolicTangent{}, nil
+	case "LogSoftmax":
+		return &neuralnet.LogSoftmaxLayer{}, nil
+	default:
+		return nil, fmt.Errorf("neuraltree: JSON unmarshal: unsupported layer type %q", jl.Type)
+	}
+}
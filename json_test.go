@@ -0,0 +1,51 @@
+package neuraltree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+)
+
+// TestNodeJSONRoundTrip guards the Weights/Biases layout
+// assumed by networkToJSON and jsonLayer.toLayer (a Dense
+// layer's weights are stored row-major as Matrix{Rows: Out,
+// Cols: In}): it uses mismatched input, hidden, and class
+// sizes so that a transposed or otherwise misordered decode
+// would change Apply's output rather than merely panic on a
+// dimension check.
+func TestNodeJSONRoundTrip(t *testing.T) {
+	root := NewNodeBinTree(1, 3, 5, 2)
+
+	data, err := root.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := DeserializeNodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := []float64{0.3, -0.7, 1.2}
+	want := root.Apply(&autofunc.Variable{Vector: append([]float64{}, in...)}).Output()
+	got := restored.Apply(&autofunc.Variable{Vector: append([]float64{}, in...)}).Output()
+
+	if len(want) != len(got) {
+		t.Fatalf("output length mismatch: got %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(want[i]-got[i]) > 1e-8 {
+			t.Errorf("output[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestDeserializeNodeJSONRejectsBadLayer confirms that an
+// unrecognized layer type produces an error instead of being
+// silently dropped.
+func TestDeserializeNodeJSONRejectsBadLayer(t *testing.T) {
+	bad := []byte(`{"network":{"layers":[{"type":"Bogus"}]}}`)
+	if _, err := DeserializeNodeJSON(bad); err == nil {
+		t.Fatal("expected an error for an unsupported layer type")
+	}
+}
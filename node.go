@@ -61,24 +61,25 @@ func DeserializeNode(d []byte) (*Node, error) {
 // of the tree, so a depth of 0 implies a single node.
 func NewNodeBinTree(depth, inSize, hiddenSize, classCount int) *Node {
 	if depth == 0 {
-		net := neuralnet.Network{
-			&neuralnet.DenseLayer{
-				InputCount:  inSize,
-				OutputCount: hiddenSize,
-			},
-			&neuralnet.HyperbolicTangent{},
-			&neuralnet.DenseLayer{
-				InputCount:  hiddenSize,
-				OutputCount: classCount,
-			},
-			&neuralnet.LogSoftmaxLayer{},
-		}
-		net.Randomize()
 		return &Node{
-			Network: net,
+			Network: newGatingNetwork(inSize, hiddenSize, classCount),
 		}
 	}
 
+	return &Node{
+		Network: newGatingNetwork(inSize, hiddenSize, 2),
+		Children: []*Node{
+			NewNodeBinTree(depth-1, inSize, hiddenSize, classCount),
+			NewNodeBinTree(depth-1, inSize, hiddenSize, classCount),
+		},
+	}
+}
+
+// newGatingNetwork creates a freshly-randomized network
+// that outputs log-probabilities over outCount branches or
+// classes, as used for both leaf classifiers and non-leaf
+// gating networks throughout this package.
+func newGatingNetwork(inSize, hiddenSize, outCount int) neuralnet.Network {
 	net := neuralnet.Network{
 		&neuralnet.DenseLayer{
 			InputCount:  inSize,
@@ -87,18 +88,12 @@ func NewNodeBinTree(depth, inSize, hiddenSize, classCount int) *Node {
 		&neuralnet.HyperbolicTangent{},
 		&neuralnet.DenseLayer{
 			InputCount:  hiddenSize,
-			OutputCount: 2,
+			OutputCount: outCount,
 		},
 		&neuralnet.LogSoftmaxLayer{},
 	}
 	net.Randomize()
-	return &Node{
-		Network: net,
-		Children: []*Node{
-			NewNodeBinTree(depth-1, inSize, hiddenSize, classCount),
-			NewNodeBinTree(depth-1, inSize, hiddenSize, classCount),
-		},
-	}
+	return net
 }
 
 // Apply runs the node on a given input, returning a
@@ -0,0 +1,235 @@
+package neuraltree
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// A Path identifies a node within a tree by the sequence of
+// child indices taken from the root to reach it. An empty
+// Path refers to the node itself.
+type Path []int
+
+// At returns the descendant of n reached by following p.
+func (n *Node) At(p Path) (*Node, error) {
+	cur := n
+	for i, idx := range p {
+		if idx < 0 || idx >= len(cur.Children) {
+			return nil, fmt.Errorf("neuraltree: At: invalid path component %d at depth %d", idx, i)
+		}
+		cur = cur.Children[idx]
+	}
+	return cur, nil
+}
+
+// Walk calls f once for every node in the subtree rooted at
+// n (including n itself), passing each node's Path relative
+// to n. Traversal is depth-first, in child order; if f
+// returns false for a node, Walk does not descend into that
+// node's children.
+func (n *Node) Walk(f func(p Path, node *Node) bool) {
+	n.walk(nil, f)
+}
+
+func (n *Node) walk(prefix Path, f func(Path, *Node) bool) {
+	if !f(prefix, n) {
+		return
+	}
+	for i, child := range n.Children {
+		childPath := append(append(Path{}, prefix...), i)
+		child.walk(childPath, f)
+	}
+}
+
+// Subtree returns a deep copy of the node at p, so that
+// mutating the result never affects n.
+func (n *Node) Subtree(p Path) (*Node, error) {
+	node, err := n.At(p)
+	if err != nil {
+		return nil, err
+	}
+	return node.deepCopy(), nil
+}
+
+// Graft replaces the subtree at p with sub, validating that
+// sub's input size and class count match those of the
+// subtree it replaces.
+func (n *Node) Graft(p Path, sub *Node) error {
+	if len(p) == 0 {
+		if err := validateGraft(n, sub); err != nil {
+			return err
+		}
+		*n = *sub
+		return nil
+	}
+	parent, err := n.At(p[:len(p)-1])
+	if err != nil {
+		return err
+	}
+	idx := p[len(p)-1]
+	if idx < 0 || idx >= len(parent.Children) {
+		return fmt.Errorf("neuraltree: Graft: invalid path component %d", idx)
+	}
+	if err := validateGraft(parent.Children[idx], sub); err != nil {
+		return err
+	}
+	parent.Children[idx] = sub
+	return nil
+}
+
+// Depth returns the number of non-leaf layers on the
+// longest path from n to a leaf; a leaf has depth 0.
+func (n *Node) Depth() int {
+	if len(n.Children) == 0 {
+		return 0
+	}
+	max := 0
+	for _, c := range n.Children {
+		if d := c.Depth(); d > max {
+			max = d
+		}
+	}
+	return max + 1
+}
+
+// LeafCount returns the number of leaves in the subtree
+// rooted at n.
+func (n *Node) LeafCount() int {
+	if len(n.Children) == 0 {
+		return 1
+	}
+	count := 0
+	for _, c := range n.Children {
+		count += c.LeafCount()
+	}
+	return count
+}
+
+// Prune collapses the node at p into a new leaf, replacing
+// its network with a freshly-initialized classifier head.
+// The replacement outputs the same number of classes as the
+// subtree it replaces, and uses the same hidden layer size
+// and input size as the pruned node's own gating network.
+func (n *Node) Prune(p Path) error {
+	node, err := n.At(p)
+	if err != nil {
+		return err
+	}
+	if len(node.Children) == 0 {
+		return nil
+	}
+	inSize, err := node.inputSize()
+	if err != nil {
+		return err
+	}
+	hidden, err := node.hiddenSize()
+	if err != nil {
+		return err
+	}
+	classes, err := node.classCount()
+	if err != nil {
+		return err
+	}
+	node.Network = newGatingNetwork(inSize, hidden, classes)
+	node.Children = nil
+	return nil
+}
+
+// deepCopy returns a copy of n whose Network and Children
+// can be mutated independently of n's.
+func (n *Node) deepCopy() *Node {
+	res := &Node{Network: copyNetwork(n.Network)}
+	if len(n.Children) > 0 {
+		res.Children = make([]*Node, len(n.Children))
+		for i, c := range n.Children {
+			res.Children[i] = c.deepCopy()
+		}
+	}
+	return res
+}
+
+// copyNetwork deep-copies a network by round-tripping it
+// through the serializer package.
+func copyNetwork(net neuralnet.Network) neuralnet.Network {
+	data, err := net.Serialize()
+	if err != nil {
+		panic(err)
+	}
+	copied, err := neuralnet.DeserializeNetwork(data)
+	if err != nil {
+		panic(err)
+	}
+	return copied
+}
+
+// inputSize returns the input size of n's own network, or an
+// error if n's network doesn't start with a *neuralnet.DenseLayer,
+// as built by newGatingNetwork.
+func (n *Node) inputSize() (int, error) {
+	dense, ok := n.Network[0].(*neuralnet.DenseLayer)
+	if !ok {
+		return 0, fmt.Errorf("neuraltree: network starts with a %T, not a *neuralnet.DenseLayer", n.Network[0])
+	}
+	return dense.InputCount, nil
+}
+
+// hiddenSize returns the hidden layer size of n's own
+// network, or an error if n's network doesn't start with a
+// *neuralnet.DenseLayer, as built by newGatingNetwork.
+func (n *Node) hiddenSize() (int, error) {
+	dense, ok := n.Network[0].(*neuralnet.DenseLayer)
+	if !ok {
+		return 0, fmt.Errorf("neuraltree: network starts with a %T, not a *neuralnet.DenseLayer", n.Network[0])
+	}
+	return dense.OutputCount, nil
+}
+
+// classCount returns the number of classes output by the
+// leaves of the subtree rooted at n, found by descending
+// through first children until a leaf is reached. It returns
+// an error if that leaf's network doesn't have a
+// *neuralnet.DenseLayer immediately before its output layer,
+// as built by newGatingNetwork.
+func (n *Node) classCount() (int, error) {
+	cur := n
+	for len(cur.Children) > 0 {
+		cur = cur.Children[0]
+	}
+	dense, ok := cur.Network[len(cur.Network)-2].(*neuralnet.DenseLayer)
+	if !ok {
+		return 0, fmt.Errorf("neuraltree: leaf network has a %T before its output layer, not a *neuralnet.DenseLayer",
+			cur.Network[len(cur.Network)-2])
+	}
+	return dense.OutputCount, nil
+}
+
+// validateGraft returns an error if sub cannot validly
+// replace old in a Graft: their input sizes and class counts
+// must both match.
+func validateGraft(old, sub *Node) error {
+	oldIn, err := old.inputSize()
+	if err != nil {
+		return err
+	}
+	subIn, err := sub.inputSize()
+	if err != nil {
+		return err
+	}
+	if oldIn != subIn {
+		return errors.New("neuraltree: Graft: input size mismatch")
+	}
+	oldClasses, err := old.classCount()
+	if err != nil {
+		return err
+	}
+	subClasses, err := sub.classCount()
+	if err != nil {
+		return err
+	}
+	if oldClasses != subClasses {
+		return errors.New("neuraltree: Graft: class count mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package neuraltree
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestAt(t *testing.T) {
+	root := NewNodeBinTree(2, 2, 3, 2)
+
+	if node, err := root.At(Path{}); err != nil || node != root {
+		t.Errorf("At({}) = %v, %v; want root, nil", node, err)
+	}
+	if node, err := root.At(Path{0}); err != nil || node != root.Children[0] {
+		t.Errorf("At({0}) = %v, %v; want root.Children[0], nil", node, err)
+	}
+	if node, err := root.At(Path{1, 0}); err != nil || node != root.Children[1].Children[0] {
+		t.Errorf("At({1,0}) = %v, %v; want root.Children[1].Children[0], nil", node, err)
+	}
+	if _, err := root.At(Path{2}); err == nil {
+		t.Error("expected an error for an out-of-range path component")
+	}
+	if _, err := root.At(Path{0, 0, 0}); err == nil {
+		t.Error("expected an error for a path that overruns a leaf")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := NewNodeBinTree(1, 2, 3, 2)
+
+	var visited []Path
+	root.Walk(func(p Path, node *Node) bool {
+		visited = append(visited, append(Path{}, p...))
+		return true
+	})
+
+	want := []Path{{}, {0}, {1}}
+	if len(visited) != len(want) {
+		t.Fatalf("visited %d nodes, want %d", len(visited), len(want))
+	}
+	for i, p := range want {
+		if !reflect.DeepEqual(visited[i], p) {
+			t.Errorf("visited[%d] = %v, want %v", i, visited[i], p)
+		}
+	}
+
+	var visitedStoppedEarly []Path
+	root.Walk(func(p Path, node *Node) bool {
+		visitedStoppedEarly = append(visitedStoppedEarly, append(Path{}, p...))
+		return false
+	})
+	if len(visitedStoppedEarly) != 1 {
+		t.Errorf("returning false should stop descent: visited %v", visitedStoppedEarly)
+	}
+}
+
+func TestSubtreeIsDeepCopy(t *testing.T) {
+	root := NewNodeBinTree(2, 2, 3, 2)
+
+	copied, err := root.Subtree(Path{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := root.Children[0]
+	origWeight := orig.Network[0].(*neuralnet.DenseLayer).Weights.Data.Vector[0]
+	copied.Network[0].(*neuralnet.DenseLayer).Weights.Data.Vector[0] += 1
+
+	if orig.Network[0].(*neuralnet.DenseLayer).Weights.Data.Vector[0] != origWeight {
+		t.Error("mutating the copy's weights affected the original")
+	}
+
+	origChildCount := len(orig.Children)
+	copied.Children = nil
+	if len(orig.Children) != origChildCount {
+		t.Error("mutating the copy's Children affected the original")
+	}
+}
+
+func TestGraftAtRoot(t *testing.T) {
+	root := NewNodeBinTree(1, 2, 3, 2)
+	sub := NewNodeBinTree(2, 2, 3, 2)
+
+	if err := root.Graft(Path{}, sub); err != nil {
+		t.Fatal(err)
+	}
+	if root.Depth() != 2 {
+		t.Errorf("root.Depth() = %d, want 2 after grafting in a deeper subtree", root.Depth())
+	}
+}
+
+func TestGraftNested(t *testing.T) {
+	root := NewNodeBinTree(1, 2, 3, 2)
+	sub := NewNodeBinTree(2, 2, 3, 2)
+
+	if err := root.Graft(Path{0}, sub); err != nil {
+		t.Fatal(err)
+	}
+	if root.Children[0] != sub {
+		t.Error("Graft did not replace the child at the given path")
+	}
+	if root.Children[1].Depth() != 0 {
+		t.Error("Graft affected a sibling it shouldn't have touched")
+	}
+}
+
+func TestGraftRejectsMismatches(t *testing.T) {
+	root := NewNodeBinTree(1, 2, 3, 2)
+
+	if err := root.Graft(Path{0}, NewNodeBinTree(1, 5, 3, 2)); err == nil {
+		t.Error("expected an error grafting in a subtree with a mismatched input size")
+	}
+	if err := root.Graft(Path{0}, NewNodeBinTree(1, 2, 3, 5)); err == nil {
+		t.Error("expected an error grafting in a subtree with a mismatched class count")
+	}
+	if err := root.Graft(Path{5}, NewNodeBinTree(1, 2, 3, 2)); err == nil {
+		t.Error("expected an error grafting at an invalid path")
+	}
+}
+
+func TestDepthAndLeafCount(t *testing.T) {
+	root := NewNodeBinTree(2, 2, 3, 2)
+	if root.Depth() != 2 {
+		t.Errorf("Depth() = %d, want 2", root.Depth())
+	}
+	if root.LeafCount() != 4 {
+		t.Errorf("LeafCount() = %d, want 4", root.LeafCount())
+	}
+
+	shaped := NewNodeTree([]int{3, 2}, 2, 3, 2)
+	if shaped.Depth() != 2 {
+		t.Errorf("Depth() = %d, want 2", shaped.Depth())
+	}
+	if shaped.LeafCount() != 6 {
+		t.Errorf("LeafCount() = %d, want 6", shaped.LeafCount())
+	}
+}
+
+func TestPruneCollapsesToLeaf(t *testing.T) {
+	root := NewNodeBinTree(2, 2, 3, 2)
+
+	if err := root.Prune(Path{0}); err != nil {
+		t.Fatal(err)
+	}
+	node, err := root.At(Path{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Children) != 0 {
+		t.Errorf("Prune left %d children, want 0", len(node.Children))
+	}
+	classes, err := node.classCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if classes != 2 {
+		t.Errorf("pruned node outputs %d classes, want 2", classes)
+	}
+
+	if err := root.Prune(Path{5}); err == nil {
+		t.Error("expected an error pruning at an invalid path")
+	}
+}
@@ -0,0 +1,124 @@
+package neuraltree
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/unixpickle/autofunc"
+)
+
+// A RoutingMode selects how ApplyRouted descends through a
+// Node's children.
+type RoutingMode int
+
+const (
+	// Soft descends into every child and combines their
+	// outputs with the log-sum-exp mixture, exactly like
+	// Apply. It is fully differentiable.
+	Soft RoutingMode = iota
+
+	// Hard descends into only the single child with the
+	// largest log-weight and returns that child's output
+	// directly, discarding every other child.
+	Hard
+
+	// TopK descends into the k children with the largest
+	// log-weights and combines their outputs with the
+	// log-sum-exp mixture, preserving their network weights.
+	// TopK with k equal to the node's number of children is
+	// equivalent to Soft.
+	TopK
+)
+
+// ApplyRouted is like Apply, but mode selects which
+// children are descended into.
+//
+// In Hard and TopK (with k less than the number of
+// children) modes, the choice of children is made from the
+// node's decision weights, which are treated as constants
+// for this purpose: the autofunc graph is only built along
+// the chosen paths, so gradients do not flow to children
+// that were not selected. This makes Hard and TopK
+// inference-only optimizations, not valid substitutes for
+// Apply when constructing a training graph; use Soft (or
+// TopK with k == len(n.Children), which degrades to the
+// same computation as Soft) when gradients with respect to
+// every child are required. ApplyRouted has no way to tell
+// whether its result feeds into a training graph, so nothing
+// here enforces that restriction: it's a contract the caller
+// is responsible for upholding.
+func (n *Node) ApplyRouted(input autofunc.Result, mode RoutingMode, k int) (autofunc.Result, error) {
+	if len(n.Children) == 0 {
+		return n.Network.Apply(input), nil
+	}
+
+	decisionWeights := n.Network.Apply(input)
+	if len(decisionWeights.Output()) != len(n.Children) {
+		panic("child node count must match network output size")
+	}
+
+	switch mode {
+	case Soft:
+		return n.Apply(input), nil
+	case Hard:
+		best := argmax(decisionWeights.Output())
+		childOut, err := n.Children[best].ApplyRouted(input, Hard, 0)
+		if err != nil {
+			return nil, err
+		}
+		return childOut, nil
+	case TopK:
+		if k <= 0 || k > len(n.Children) {
+			return nil, errors.New("neuraltree: k out of range")
+		}
+		if k == len(n.Children) {
+			return n.Apply(input), nil
+		}
+		indices := topKIndices(decisionWeights.Output(), k)
+		var res autofunc.Result
+		for _, i := range indices {
+			weight := autofunc.Slice(decisionWeights, i, i+1)
+			childK := k
+			if childK > len(n.Children[i].Children) {
+				childK = len(n.Children[i].Children)
+			}
+			childOut, err := n.Children[i].ApplyRouted(input, TopK, childK)
+			if err != nil {
+				return nil, err
+			}
+			weighted := autofunc.AddFirst(childOut, weight)
+			if res == nil {
+				res = weighted
+			} else {
+				res = logExpSum(res, weighted)
+			}
+		}
+		return res, nil
+	default:
+		return nil, errors.New("neuraltree: unknown routing mode")
+	}
+}
+
+// argmax returns the index of the largest value in v.
+func argmax(v []float64) int {
+	best := 0
+	for i, x := range v {
+		if x > v[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// topKIndices returns the indices of the k largest values
+// in v, in descending order of value.
+func topKIndices(v []float64, k int) []int {
+	indices := make([]int, len(v))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return v[indices[i]] > v[indices[j]]
+	})
+	return indices[:k]
+}
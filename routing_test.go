@@ -0,0 +1,103 @@
+package neuraltree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+)
+
+func TestApplyRoutedHardReturnsRawBestLeafOutput(t *testing.T) {
+	leaf0 := constantGateNode([]float64{1, 2}, nil)
+	leaf1 := constantGateNode([]float64{3, -3}, nil)
+	root := constantGateNode([]float64{-5, 0}, []*Node{leaf0, leaf1}) // argmax is leaf1
+
+	input := &autofunc.Variable{Vector: []float64{0}}
+	got, err := root.ApplyRouted(input, Hard, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := leaf1.Apply(input).Output()
+	if !vectorsClose(got.Output(), want, 1e-8) {
+		t.Errorf("ApplyRouted(Hard) = %v, want the raw output of the best leaf %v", got.Output(), want)
+	}
+}
+
+func TestApplyRoutedTopKEqualsSoftWhenKEqualsChildCount(t *testing.T) {
+	leaf0 := constantGateNode([]float64{1, 2}, nil)
+	leaf1 := constantGateNode([]float64{3, -3}, nil)
+	root := constantGateNode([]float64{-5, 0}, []*Node{leaf0, leaf1})
+
+	input := &autofunc.Variable{Vector: []float64{0}}
+	got, err := root.ApplyRouted(input, TopK, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := root.Apply(input).Output()
+	if !vectorsClose(got.Output(), want, 1e-8) {
+		t.Errorf("ApplyRouted(TopK, k=len(children)) = %v, want Apply's output %v", got.Output(), want)
+	}
+}
+
+func TestApplyRoutedTopKCombinesOnlySelectedChildren(t *testing.T) {
+	leaf0 := constantGateNode([]float64{1, 2}, nil)
+	leaf1 := constantGateNode([]float64{0, -1}, nil)
+	leaf2 := constantGateNode([]float64{5, 5}, nil) // excluded: smallest gate weight
+	root := constantGateNode([]float64{2, 0, -5}, []*Node{leaf0, leaf1, leaf2})
+
+	input := &autofunc.Variable{Vector: []float64{0}}
+	got, err := root.ApplyRouted(input, TopK, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gateLogP := logSoftmax([]float64{2, 0, -5})
+	leaf0LogP := logSoftmax([]float64{1, 2})
+	leaf1LogP := logSoftmax([]float64{0, -1})
+	want := make([]float64, 2)
+	for y := range want {
+		want[y] = logSumExp([]float64{
+			gateLogP[0] + leaf0LogP[y],
+			gateLogP[1] + leaf1LogP[y],
+		})
+	}
+	if !vectorsClose(got.Output(), want, 1e-6) {
+		t.Errorf("ApplyRouted(TopK, k=2) = %v, want %v", got.Output(), want)
+	}
+}
+
+func TestApplyRoutedTopKRejectsOutOfRangeK(t *testing.T) {
+	root := constantGateNode([]float64{0, 0}, []*Node{
+		constantGateNode([]float64{0, 0}, nil),
+		constantGateNode([]float64{0, 0}, nil),
+	})
+	input := &autofunc.Variable{Vector: []float64{0}}
+	for _, k := range []int{0, -1, 3} {
+		if _, err := root.ApplyRouted(input, TopK, k); err == nil {
+			t.Errorf("expected an error for k=%d out of range", k)
+		}
+	}
+}
+
+func TestApplyRoutedRejectsUnknownMode(t *testing.T) {
+	root := constantGateNode([]float64{0, 0}, []*Node{
+		constantGateNode([]float64{0, 0}, nil),
+		constantGateNode([]float64{0, 0}, nil),
+	})
+	input := &autofunc.Variable{Vector: []float64{0}}
+	if _, err := root.ApplyRouted(input, RoutingMode(99), 0); err == nil {
+		t.Error("expected an error for an unrecognized routing mode")
+	}
+}
+
+func vectorsClose(a, b []float64, eps float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > eps {
+			return false
+		}
+	}
+	return true
+}
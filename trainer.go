@@ -0,0 +1,287 @@
+package neuraltree
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/sgd"
+)
+
+// A Sample is a single training example for a Trainer: an
+// input vector paired with the index of its correct class.
+type Sample struct {
+	Input autofunc.Result
+	Label int
+}
+
+// A Trainer trains a Node end-to-end with SGD on the
+// negative log-likelihood of a SampleSet of Samples, i.e.
+// -Apply(x)[y] for each (x, y), since leaf outputs are
+// already log-probabilities averaged across children.
+//
+// It also supports a branch-entropy regularizer that
+// discourages the tree from collapsing its probability mass
+// onto a single child of each non-leaf node, which is a
+// common failure mode when training tree-structured models.
+type Trainer struct {
+	Node *Node
+
+	// Lambda weights the branch-entropy regularization term.
+	// A value of 0 disables it entirely.
+	Lambda float64
+
+	// BatchSize is the number of samples used per gradient
+	// step. If 0, a default of 32 is used.
+	BatchSize int
+
+	// StepSize is the SGD learning rate.
+	StepSize float64
+}
+
+// Train runs one epoch of SGD over s: s is shuffled, split
+// into batches of BatchSize, and the node's parameters are
+// updated once per batch.
+func (t *Trainer) Train(s sgd.SampleSet) {
+	sgd.ShuffleSampleSet(s)
+	batchSize := t.BatchSize
+	if batchSize == 0 {
+		batchSize = 32
+	}
+	for i := 0; i < s.Len(); i += batchSize {
+		end := i + batchSize
+		if end > s.Len() {
+			end = s.Len()
+		}
+		batch := make([]Sample, 0, end-i)
+		for j := i; j < end; j++ {
+			batch = append(batch, s.GetSample(j).(Sample))
+		}
+		t.step(batch)
+	}
+}
+
+// step applies a single gradient descent step for a batch.
+func (t *Trainer) step(batch []Sample) {
+	params := t.Node.Parameters()
+	grad := autofunc.NewGradient(params)
+	cost := t.batchCost(batch)
+	cost.PropagateGradient([]float64{1}, grad)
+	grad.Scale(-t.StepSize)
+	grad.AddToVars()
+}
+
+// batchCost computes the mean NLL of batch under t.Node,
+// minus t.Lambda times the sum, over every non-leaf node in
+// the tree, of the entropy of that node's batch-averaged
+// posterior, as a scalar autofunc.Result.
+func (t *Trainer) batchCost(batch []Sample) autofunc.Result {
+	lls, entropy := t.Node.logLikelihoodEntropyBatch(batch)
+	var nll autofunc.Result
+	for _, ll := range lls {
+		negLL := autofunc.Scale(ll, -1)
+		if nll == nil {
+			nll = negLL
+		} else {
+			nll = autofunc.Add(nll, negLL)
+		}
+	}
+	cost := autofunc.Scale(nll, 1/float64(len(batch)))
+	if entropy != nil && t.Lambda != 0 {
+		cost = autofunc.Add(cost, autofunc.Scale(entropy, -t.Lambda))
+	}
+	return cost
+}
+
+// entropyEpsilon keeps log(meanP[c]) finite when a child's
+// batch-mean posterior underflows to exactly 0.
+const entropyEpsilon = 1e-12
+
+// logLikelihoodEntropyBatch computes, for every sample in
+// batch, its log-probability under n (i.e. Apply(x)[y]),
+// along with the sum over every non-leaf node in the
+// subtree rooted at n of that node's branch-entropy
+// regularization term H(mean_x p_v(·|x)), where p_v is the
+// node's posterior usage distribution:
+//
+//	p_v(i|x) = exp(w_i) * exp(child_i.logP(y|x)) / exp(Apply_v(x)[y])
+//
+// Unlike averaging H(p_v(·|x)) over the batch, taking the
+// entropy of the batch-averaged posterior only penalizes a
+// node for collapsing onto one child across the whole
+// batch, while still allowing individual samples to be
+// routed sharply. The entropy return value is nil wherever
+// n is a leaf.
+func (n *Node) logLikelihoodEntropyBatch(batch []Sample) (lls []autofunc.Result, entropy autofunc.Result) {
+	outs := make([]autofunc.Result, len(batch))
+	for i, sample := range batch {
+		outs[i] = n.Network.Apply(sample.Input)
+	}
+	if len(n.Children) == 0 {
+		lls = make([]autofunc.Result, len(batch))
+		for i, sample := range batch {
+			lls[i] = autofunc.Slice(outs[i], sample.Label, sample.Label+1)
+		}
+		return lls, nil
+	}
+	if len(outs[0].Output()) != len(n.Children) {
+		panic("child node count must match network output size")
+	}
+
+	childLLs := make([][]autofunc.Result, len(n.Children))
+	var childEntropy autofunc.Result
+	for c, child := range n.Children {
+		lls, ent := child.logLikelihoodEntropyBatch(batch)
+		childLLs[c] = lls
+		if ent != nil {
+			if childEntropy == nil {
+				childEntropy = ent
+			} else {
+				childEntropy = autofunc.Add(childEntropy, ent)
+			}
+		}
+	}
+
+	weighted := make([][]autofunc.Result, len(n.Children))
+	for c := range n.Children {
+		weighted[c] = make([]autofunc.Result, len(batch))
+	}
+	combined := make([]autofunc.Result, len(batch))
+	for i := range batch {
+		var comb autofunc.Result
+		for c := range n.Children {
+			w := autofunc.Slice(outs[i], c, c+1)
+			weighted[c][i] = autofunc.Add(childLLs[c][i], w)
+			if comb == nil {
+				comb = weighted[c][i]
+			} else {
+				comb = logExpSum(comb, weighted[c][i])
+			}
+		}
+		combined[i] = comb
+	}
+
+	meanP := make([]autofunc.Result, len(n.Children))
+	for c := range n.Children {
+		var sum autofunc.Result
+		for i := range batch {
+			logP := autofunc.Add(weighted[c][i], autofunc.Scale(combined[i], -1))
+			p := autofunc.Exp{}.Apply(logP)
+			if sum == nil {
+				sum = p
+			} else {
+				sum = autofunc.Add(sum, p)
+			}
+		}
+		meanP[c] = autofunc.Scale(sum, 1/float64(len(batch)))
+	}
+
+	var nodeEntropy autofunc.Result
+	for _, p := range meanP {
+		// A child's batch-mean posterior can underflow to
+		// exactly 0 once a node routes confidently, which is
+		// exactly the regime this regularizer is meant to
+		// correct; without the epsilon, Log{}.Apply(0) is -Inf
+		// and Mul(0, -Inf) is NaN, whereas with it the term is
+		// 0, matching the standard 0*log(0)=0 entropy convention.
+		logP := autofunc.Log{}.Apply(autofunc.AddScaler(p, entropyEpsilon))
+		term := autofunc.Mul(p, logP)
+		if nodeEntropy == nil {
+			nodeEntropy = term
+		} else {
+			nodeEntropy = autofunc.Add(nodeEntropy, term)
+		}
+	}
+	nodeEntropy = autofunc.Scale(nodeEntropy, -1)
+
+	entropy = nodeEntropy
+	if childEntropy != nil {
+		entropy = autofunc.Add(entropy, childEntropy)
+	}
+	return combined, entropy
+}
+
+// PruneDeadBranches evaluates the average gate weight that
+// every non-leaf node assigns to each of its children over
+// s, and removes children whose average gate weight falls
+// below threshold:
+//
+//   - If every child survives, the node is left untouched.
+//   - If exactly one child survives, the node is replaced in
+//     place by that child's subtree.
+//   - If two or more children survive (but not all), the
+//     node keeps only the surviving children and gets a
+//     freshly-initialized gating network sized for them.
+//   - If no child survives, the node is folded into a new
+//     leaf, exactly as Prune does.
+func (t *Trainer) PruneDeadBranches(s sgd.SampleSet, threshold float64) error {
+	return t.Node.pruneDeadBranches(s, threshold)
+}
+
+func (n *Node) pruneDeadBranches(s sgd.SampleSet, threshold float64) error {
+	for _, child := range n.Children {
+		if err := child.pruneDeadBranches(s, threshold); err != nil {
+			return err
+		}
+	}
+	if len(n.Children) == 0 {
+		return nil
+	}
+
+	avgWeights := n.averageChildWeights(s)
+	var survivors []int
+	for i, w := range avgWeights {
+		if w >= threshold {
+			survivors = append(survivors, i)
+		}
+	}
+	if len(survivors) == len(n.Children) {
+		return nil
+	}
+
+	inSize, err := n.inputSize()
+	if err != nil {
+		return err
+	}
+	hidden, err := n.hiddenSize()
+	if err != nil {
+		return err
+	}
+
+	switch len(survivors) {
+	case 0:
+		classes, err := n.classCount()
+		if err != nil {
+			return err
+		}
+		n.Network = newGatingNetwork(inSize, hidden, classes)
+		n.Children = nil
+	case 1:
+		*n = *n.Children[survivors[0]]
+	default:
+		children := make([]*Node, len(survivors))
+		for i, idx := range survivors {
+			children[i] = n.Children[idx]
+		}
+		n.Network = newGatingNetwork(inSize, hidden, len(children))
+		n.Children = children
+	}
+	return nil
+}
+
+// averageChildWeights returns, for each child of n, the
+// average (over s) of the probability that n's gating
+// network assigns to that child.
+func (n *Node) averageChildWeights(s sgd.SampleSet) []float64 {
+	sums := make([]float64, len(n.Children))
+	for i := 0; i < s.Len(); i++ {
+		sample := s.GetSample(i).(Sample)
+		weights := n.Network.Apply(sample.Input).Output()
+		for c, w := range weights {
+			sums[c] += math.Exp(w)
+		}
+	}
+	for i := range sums {
+		sums[i] /= float64(s.Len())
+	}
+	return sums
+}
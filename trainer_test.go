@@ -0,0 +1,230 @@
+package neuraltree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// sliceSampleSet is a minimal sgd.SampleSet backed by a
+// slice of Samples, used to drive Trainer in tests without
+// pulling in a heavier SampleSet implementation.
+type sliceSampleSet []Sample
+
+func (s sliceSampleSet) Len() int                    { return len(s) }
+func (s sliceSampleSet) Swap(i, j int)               { s[i], s[j] = s[j], s[i] }
+func (s sliceSampleSet) GetSample(i int) interface{} { return s[i] }
+func (s sliceSampleSet) Copy() sgd.SampleSet {
+	res := make(sliceSampleSet, len(s))
+	copy(res, s)
+	return res
+}
+func (s sliceSampleSet) Subset(i, j int) sgd.SampleSet { return s[i:j] }
+
+// testGatingNode builds a 1-hidden-unit node network
+// (Dense, Tanh, Dense, LogSoftmax) with explicit weights, so
+// tests can drive it with known, reproducible outputs
+// instead of Randomize's random ones.
+func testGatingNode(w1, b1 float64, w2, b2 []float64, children []*Node) *Node {
+	net := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  1,
+			OutputCount: 1,
+			Weights: &neuralnet.Matrix{
+				Data: &autofunc.Variable{Vector: []float64{w1}},
+				Rows: 1,
+				Cols: 1,
+			},
+			Biases: &autofunc.Variable{Vector: []float64{b1}},
+		},
+		&neuralnet.HyperbolicTangent{},
+		&neuralnet.DenseLayer{
+			InputCount:  1,
+			OutputCount: len(w2),
+			Weights: &neuralnet.Matrix{
+				Data: &autofunc.Variable{Vector: append([]float64{}, w2...)},
+				Rows: len(w2),
+				Cols: 1,
+			},
+			Biases: &autofunc.Variable{Vector: append([]float64{}, b2...)},
+		},
+		&neuralnet.LogSoftmaxLayer{},
+	}
+	return &Node{Network: net, Children: children}
+}
+
+// constantGateNode is testGatingNode with its first layer
+// zeroed out, so its output is the log-softmax of logits
+// regardless of the input it's applied to.
+func constantGateNode(logits []float64, children []*Node) *Node {
+	return testGatingNode(0, 0, make([]float64, len(logits)), logits, children)
+}
+
+func logSumExp(vals []float64) float64 {
+	max := vals[0]
+	for _, v := range vals[1:] {
+		if v > max {
+			max = v
+		}
+	}
+	var sum float64
+	for _, v := range vals {
+		sum += math.Exp(v - max)
+	}
+	return max + math.Log(sum)
+}
+
+func logSoftmax(logits []float64) []float64 {
+	logSum := logSumExp(logits)
+	res := make([]float64, len(logits))
+	for i, l := range logits {
+		res[i] = l - logSum
+	}
+	return res
+}
+
+// TestLogLikelihoodEntropyBatchRegularizesBatchMeanPosterior
+// guards against the regression where batchCost regularized
+// the mean of each sample's branch entropy instead of the
+// entropy of the batch-mean posterior: the two formulas only
+// agree when every sample in the batch routes identically,
+// so this test uses a gating network whose decision actually
+// depends on the input, giving each sample a different
+// posterior.
+func TestLogLikelihoodEntropyBatchRegularizesBatchMeanPosterior(t *testing.T) {
+	leaf0 := constantGateNode([]float64{0, 0}, nil)
+	leaf1 := constantGateNode([]float64{1, -1}, nil)
+	root := testGatingNode(1, 0, []float64{1, -1}, []float64{0, 0}, []*Node{leaf0, leaf1})
+
+	leaf0LogP := logSoftmax([]float64{0, 0})
+	leaf1LogP := logSoftmax([]float64{1, -1})
+
+	xs := []float64{1, -1}
+	labels := []int{0, 1}
+	batch := make([]Sample, len(xs))
+	for i, x := range xs {
+		batch[i] = Sample{Input: &autofunc.Variable{Vector: []float64{x}}, Label: labels[i]}
+	}
+
+	wantLLs := make([]float64, len(xs))
+	p := make([][2]float64, len(xs))
+	for i, x := range xs {
+		h := math.Tanh(x)
+		gateLogP := logSoftmax([]float64{h, -h})
+		weighted := [2]float64{
+			gateLogP[0] + leaf0LogP[labels[i]],
+			gateLogP[1] + leaf1LogP[labels[i]],
+		}
+		combined := logSumExp(weighted[:])
+		wantLLs[i] = combined
+		p[i] = [2]float64{math.Exp(weighted[0] - combined), math.Exp(weighted[1] - combined)}
+	}
+
+	var meanP [2]float64
+	for _, pi := range p {
+		meanP[0] += pi[0]
+		meanP[1] += pi[1]
+	}
+	meanP[0] /= float64(len(xs))
+	meanP[1] /= float64(len(xs))
+	wantEntropy := -(meanP[0]*math.Log(meanP[0]) + meanP[1]*math.Log(meanP[1]))
+
+	gotLLs, gotEntropy := root.logLikelihoodEntropyBatch(batch)
+	for i, ll := range gotLLs {
+		if math.Abs(ll.Output()[0]-wantLLs[i]) > 1e-6 {
+			t.Errorf("sample %d: log-likelihood = %v, want %v", i, ll.Output()[0], wantLLs[i])
+		}
+	}
+	if math.Abs(gotEntropy.Output()[0]-wantEntropy) > 1e-6 {
+		t.Errorf("entropy = %v, want %v", gotEntropy.Output()[0], wantEntropy)
+	}
+}
+
+// TestLogLikelihoodEntropyBatchHandlesZeroPosterior guards
+// against the regression where a child's batch-mean
+// posterior underflowing to exactly 0 (easily reached once a
+// node routes confidently) turned log(0)=-Inf times 0 into a
+// NaN entropy, poisoning every gradient in the step.
+func TestLogLikelihoodEntropyBatchHandlesZeroPosterior(t *testing.T) {
+	leaf0 := constantGateNode([]float64{0, 0}, nil)
+	leaf1 := constantGateNode([]float64{0, 0}, nil)
+	// -800 is well past the point where exp() underflows to
+	// exactly 0 in float64 (exp(-745) already does).
+	root := constantGateNode([]float64{-800, 0}, []*Node{leaf0, leaf1})
+
+	batch := []Sample{
+		{Input: &autofunc.Variable{Vector: []float64{0}}, Label: 0},
+		{Input: &autofunc.Variable{Vector: []float64{0}}, Label: 1},
+	}
+
+	_, entropy := root.logLikelihoodEntropyBatch(batch)
+	got := entropy.Output()[0]
+	if math.IsNaN(got) {
+		t.Fatal("entropy is NaN when a child's posterior underflows to 0")
+	}
+	if got < -1e-6 || got > 1e-3 {
+		t.Errorf("entropy = %v, want a value near 0 (one child's posterior underflowed to ~0)", got)
+	}
+}
+
+func TestPruneDeadBranches(t *testing.T) {
+	newLeaf := func() *Node { return NewNodeBinTree(0, 1, 4, 2) }
+	sample := sliceSampleSet{{Input: &autofunc.Variable{Vector: []float64{0}}, Label: 0}}
+
+	t.Run("all survive", func(t *testing.T) {
+		child0, child1 := newLeaf(), newLeaf()
+		root := constantGateNode([]float64{0, 0}, []*Node{child0, child1})
+		if err := root.pruneDeadBranches(sample, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		if len(root.Children) != 2 {
+			t.Fatalf("expected both children to survive, got %d", len(root.Children))
+		}
+	})
+
+	t.Run("single survivor grafts the child's subtree", func(t *testing.T) {
+		child0, child1, child2 := newLeaf(), newLeaf(), newLeaf()
+		root := constantGateNode([]float64{-10, 0, -10}, []*Node{child0, child1, child2})
+		if err := root.pruneDeadBranches(sample, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		if len(root.Children) != 0 {
+			t.Fatalf("expected root to collapse to the surviving leaf, got %d children", len(root.Children))
+		}
+	})
+
+	t.Run("no survivors folds into a fresh leaf", func(t *testing.T) {
+		child0, child1, child2 := newLeaf(), newLeaf(), newLeaf()
+		root := constantGateNode([]float64{0, 0, 0}, []*Node{child0, child1, child2})
+		if err := root.pruneDeadBranches(sample, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		if len(root.Children) != 0 {
+			t.Fatalf("expected root to fold into a leaf, got %d children", len(root.Children))
+		}
+		classes, err := root.classCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if classes != 2 {
+			t.Fatalf("expected the replacement leaf to output 2 classes, got %d", classes)
+		}
+	})
+
+	t.Run("partial survivors keep the node but drop dead children", func(t *testing.T) {
+		child0, child1, child2 := newLeaf(), newLeaf(), newLeaf()
+		root := constantGateNode([]float64{-10, 0, 0}, []*Node{child0, child1, child2})
+		if err := root.pruneDeadBranches(sample, 0.3); err != nil {
+			t.Fatal(err)
+		}
+		if len(root.Children) != 2 || root.Children[0] != child1 || root.Children[1] != child2 {
+			t.Fatalf("expected root to keep only child1 and child2, got %v", root.Children)
+		}
+		if len(root.Network[len(root.Network)-2].(*neuralnet.DenseLayer).Weights.Data.Vector) != 2 {
+			t.Fatalf("expected the rebuilt gate to output 2 weights")
+		}
+	})
+}
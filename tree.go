@@ -0,0 +1,44 @@
+package neuraltree
+
+// NewNodeTree creates a tree with an arbitrary, uniform
+// branching factor per depth. branchingFactors[d] gives the
+// number of children of every node at depth d, so
+// len(branchingFactors) is the number of non-leaf layers in
+// the tree. A branching factor of 1 creates a pass-through
+// layer: a single child gated by a network with one output.
+//
+// NewNodeBinTree is equivalent to calling NewNodeTree with a
+// branchingFactors slice of depth copies of 2.
+func NewNodeTree(branchingFactors []int, inSize, hiddenSize, classCount int) *Node {
+	if len(branchingFactors) == 0 {
+		return &Node{Network: newGatingNetwork(inSize, hiddenSize, classCount)}
+	}
+	factor := branchingFactors[0]
+	children := make([]*Node, factor)
+	for i := range children {
+		children[i] = NewNodeTree(branchingFactors[1:], inSize, hiddenSize, classCount)
+	}
+	return &Node{
+		Network:  newGatingNetwork(inSize, hiddenSize, factor),
+		Children: children,
+	}
+}
+
+// NewNodeTreeFromShape creates a tree with len(shape)
+// children of the root, where shape[i] gives the
+// branching factors (as accepted by NewNodeTree) for the
+// subtree rooted at the i'th child. Unlike NewNodeTree, this
+// allows different subtrees to have different depths, which
+// is useful for adaptively growing a tree by replacing a
+// single leaf's subtree (via Graft) with a deeper one built
+// from a shape tailored to just that leaf.
+func NewNodeTreeFromShape(shape [][]int, inSize, hiddenSize, classCount int) *Node {
+	children := make([]*Node, len(shape))
+	for i, branchingFactors := range shape {
+		children[i] = NewNodeTree(branchingFactors, inSize, hiddenSize, classCount)
+	}
+	return &Node{
+		Network:  newGatingNetwork(inSize, hiddenSize, len(shape)),
+		Children: children,
+	}
+}
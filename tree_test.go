@@ -0,0 +1,72 @@
+package neuraltree
+
+import (
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+)
+
+func TestNewNodeTreeUniformBranching(t *testing.T) {
+	root := NewNodeTree([]int{3, 2}, 2, 4, 5)
+
+	if len(root.Children) != 3 {
+		t.Fatalf("root has %d children, want 3", len(root.Children))
+	}
+	for i, child := range root.Children {
+		if len(child.Children) != 2 {
+			t.Errorf("child %d has %d children, want 2", i, len(child.Children))
+		}
+	}
+	if root.Depth() != 2 {
+		t.Errorf("Depth() = %d, want 2", root.Depth())
+	}
+	if root.LeafCount() != 6 {
+		t.Errorf("LeafCount() = %d, want 6", root.LeafCount())
+	}
+
+	out := root.Apply(&autofunc.Variable{Vector: []float64{0, 0}}).Output()
+	if len(out) != 5 {
+		t.Errorf("Apply output has length %d, want 5", len(out))
+	}
+}
+
+func TestNewNodeTreeBranchFactorOnePassesThrough(t *testing.T) {
+	root := NewNodeTree([]int{1}, 2, 4, 3)
+
+	if len(root.Children) != 1 {
+		t.Fatalf("root has %d children, want 1", len(root.Children))
+	}
+	if root.Depth() != 1 {
+		t.Errorf("Depth() = %d, want 1", root.Depth())
+	}
+	if root.LeafCount() != 1 {
+		t.Errorf("LeafCount() = %d, want 1", root.LeafCount())
+	}
+
+	out := root.Apply(&autofunc.Variable{Vector: []float64{0, 0}}).Output()
+	if len(out) != 3 {
+		t.Errorf("Apply output has length %d, want 3", len(out))
+	}
+}
+
+func TestNewNodeTreeFromShapeMixedDepths(t *testing.T) {
+	shape := [][]int{{2}, {1, 2}}
+	root := NewNodeTreeFromShape(shape, 2, 4, 3)
+
+	if len(root.Children) != len(shape) {
+		t.Fatalf("root has %d children, want %d", len(root.Children), len(shape))
+	}
+	if root.Children[0].Depth() != 1 || root.Children[0].LeafCount() != 2 {
+		t.Errorf("child 0: Depth()=%d LeafCount()=%d, want 1 and 2",
+			root.Children[0].Depth(), root.Children[0].LeafCount())
+	}
+	if root.Children[1].Depth() != 2 || root.Children[1].LeafCount() != 2 {
+		t.Errorf("child 1: Depth()=%d LeafCount()=%d, want 2 and 2",
+			root.Children[1].Depth(), root.Children[1].LeafCount())
+	}
+
+	out := root.Apply(&autofunc.Variable{Vector: []float64{0, 0}}).Output()
+	if len(out) != 3 {
+		t.Errorf("Apply output has length %d, want 3", len(out))
+	}
+}